@@ -0,0 +1,212 @@
+package design
+
+import (
+	. "goa.design/goa/v3/dsl"
+)
+
+// Tag is a label attached to a resource (e.g. "build", "kaniko").
+var Tag = Type("Tag", func() {
+	Attribute("id", UInt, "ID of tag")
+	Attribute("name", String, "Name of tag")
+	Required("id", "name")
+})
+
+// Catalog identifies which catalog a resource comes from.
+var Catalog = Type("Catalog", func() {
+	Attribute("id", UInt, "ID of catalog")
+	Attribute("type", String, "Name of catalog, e.g. tekton")
+	Required("id", "type")
+})
+
+// Origin records where a resource version's YAML was actually fetched from,
+// so a client can revalidate against an immutable commit without
+// re-fetching or re-parsing the resource.
+var Origin = Type("Origin", func() {
+	Attribute("vcs", String, "Kind of VCS the catalog is hosted on, e.g. git")
+	Attribute("url", String, "URL of the VCS repository")
+	Attribute("ref", String, "Ref (branch/tag) the version was fetched from")
+	Attribute("commit_sha", String, "Commit the ref resolved to at fetch time")
+	Attribute("subpath", String, "Path of the resource within the repository")
+	Attribute("fetched_at", String, "When this version was last fetched")
+})
+
+// LatestVersion is the subset of Version fields returned inline on a Resource.
+var LatestVersion = Type("LatestVersion", func() {
+	Attribute("id", UInt, "ID of resource's version")
+	Attribute("version", String, "Version of resource")
+	Attribute("description", String, "Description of the version")
+	Attribute("displayName", String, "Display name of the version")
+	Attribute("minPipelinesVersion", String, "Minimum pipelines version the resource is compatible with")
+	Attribute("webURL", String, "URL for the resource's yaml file of this version")
+	Attribute("rawURL", String, "Raw URL for the resource's yaml file of this version")
+	Attribute("updatedAt", String, "Timestamp when version was last updated")
+	Attribute("origin", Origin, "Catalog origin this version was fetched from")
+	Required("id", "version")
+})
+
+// Resource is a task or pipeline in the hub's catalog.
+var Resource = ResultType("application/vnd.resource", "Resource", func() {
+	Attribute("id", UInt, "ID of resource")
+	Attribute("name", String, "Name of resource")
+	Attribute("catalog", Catalog, "Catalog of resource")
+	Attribute("type", String, "Type of catalog to which resource belongs")
+	Attribute("rating", Int, "Rating of resource")
+	Attribute("tags", ArrayOf(Tag), "Tags related to resource")
+	Attribute("latestVersion", LatestVersion, "Latest version of resource")
+	Required("id", "name", "catalog", "type")
+})
+
+// Version is a single version of a resource, with the resource it belongs to.
+var Version = ResultType("application/vnd.version", "Version", func() {
+	Attribute("id", UInt, "ID of resource's version")
+	Attribute("version", String, "Version of resource")
+	Attribute("description", String, "Description of the version")
+	Attribute("displayName", String, "Display name of the version")
+	Attribute("minPipelinesVersion", String, "Minimum pipelines version the resource is compatible with")
+	Attribute("webURL", String, "URL for the resource's yaml file of this version")
+	Attribute("rawURL", String, "Raw URL for the resource's yaml file of this version")
+	Attribute("updatedAt", String, "Timestamp when version was last updated")
+	Attribute("origin", Origin, "Catalog origin this version was fetched from")
+	Attribute("resource", Resource, "Resource to which the version belongs")
+	Required("id", "version")
+})
+
+// ResourceList is the paginated response shared by List, Query and ByTag.
+var ResourceList = ResultType("application/vnd.resource-list", "ResourceList", func() {
+	Attribute("resources", CollectionOf(Resource), "Resources matching the request")
+	Attribute("nextCursor", String, "Cursor to fetch the next page, empty when exhausted")
+	Attribute("total", Int, "Total number of resources matching the request's filters")
+	Required("resources", "nextCursor", "total")
+})
+
+// Versions is the response for VersionsByID.
+var Versions = ResultType("application/vnd.versions", "Versions", func() {
+	Attribute("latest", Version, "Latest version of resource")
+	Attribute("versions", CollectionOf(Version), "All versions of resource")
+	Attribute("nextCursor", String, "Cursor to fetch the next page, empty when exhausted")
+	Attribute("total", Int, "Total number of versions of this resource")
+	Required("latest", "versions", "nextCursor", "total")
+})
+
+// DependencyEdge is one taskRef/stepAction edge in a DependencyGraph.
+var DependencyEdge = Type("DependencyEdge", func() {
+	Attribute("from", UInt, "ID of the version that depends on `to`")
+	Attribute("to", UInt, "ID of the version depended on")
+	Required("from", "to")
+})
+
+// DependencyGraph is the resolved closure of a version's taskRef/stepAction
+// dependencies, so an installer can pull the whole thing in one shot.
+var DependencyGraph = ResultType("application/vnd.dependency-graph", "DependencyGraph", func() {
+	Attribute("nodes", CollectionOf(Version), "Every version in the dependency closure, including the root")
+	Attribute("edges", ArrayOf(DependencyEdge), "Dependency edges between the nodes")
+	Required("nodes", "edges")
+})
+
+var _ = Service("resource", func() {
+	Description("The resource service exposes the hub's catalog of tasks and pipelines.")
+
+	Method("Query", func() {
+		Description("Find resources based on name, type, tags or a combination of these")
+		Payload(func() {
+			Attribute("name", String, "Name of resource to search for")
+			Attribute("type", String, "Type of resource to search for")
+			Attribute("tags", ArrayOf(String), "Tags to filter resources by")
+			Attribute("match_all", Boolean, "Require every given tag instead of any", func() { Default(false) })
+			Attribute("limit", Int, "Maximum number of resources to return", func() { Default(1000) })
+			Attribute("after", String, "Cursor to resume listing from")
+		})
+		Result(ResourceList)
+		HTTP(func() {
+			GET("/query")
+			Param("name")
+			Param("type")
+			Param("tags")
+			Param("match_all")
+			Param("limit")
+			Param("after")
+			Response(StatusOK)
+		})
+	})
+
+	Method("List", func() {
+		Description("List all resources sorted by rating and name")
+		Payload(func() {
+			Attribute("limit", Int, "Maximum number of resources to return", func() { Default(1000) })
+			Attribute("after", String, "Cursor to resume listing from")
+		})
+		Result(ResourceList)
+		HTTP(func() {
+			GET("/resources")
+			Param("limit")
+			Param("after")
+			Response(StatusOK)
+		})
+	})
+
+	Method("ByTag", func() {
+		Description("Find resources carrying a given tag, e.g. browse all tasks tagged kaniko")
+		Payload(func() {
+			Attribute("tag", String, "Tag to filter resources by")
+			Attribute("limit", Int, "Maximum number of resources to return", func() { Default(1000) })
+			Attribute("after", String, "Cursor to resume listing from")
+			Required("tag")
+		})
+		Result(ResourceList)
+		HTTP(func() {
+			GET("/resources/bytag/{tag}")
+			Param("limit")
+			Param("after")
+			Response(StatusOK)
+		})
+	})
+
+	Method("VersionsByID", func() {
+		Description("Get all versions of a resource given its resource id")
+		Payload(func() {
+			Attribute("id", UInt, "ID of resource")
+			Attribute("limit", Int, "Maximum number of versions to return", func() { Default(1000) })
+			Attribute("after", String, "Cursor to resume listing from")
+			Required("id")
+		})
+		Result(Versions)
+		HTTP(func() {
+			GET("/resource/{id}/versions")
+			Param("limit")
+			Param("after")
+			Response(StatusOK)
+		})
+	})
+
+	Method("ByTypeNameVersion", func() {
+		Description("Find a resource using its name, type and version")
+		Payload(func() {
+			Attribute("type", String, "Type of resource")
+			Attribute("name", String, "Name of resource")
+			Attribute("version", String, "Version of resource")
+			Required("type", "name", "version")
+		})
+		Result(Version)
+		HTTP(func() {
+			GET("/resource/{type}/{name}/{version}")
+			Response(StatusOK)
+		})
+	})
+
+	Method("Dependencies", func() {
+		Description("Resolve the taskRef/stepAction dependencies of a resource version into the hub's own catalog, so installing a pipeline can pull its tasks in one shot")
+		Payload(func() {
+			Attribute("type", String, "Type of resource")
+			Attribute("name", String, "Name of resource")
+			Attribute("version", String, "Version of resource")
+			Attribute("transitive", Boolean, "Resolve dependencies-of-dependencies too", func() { Default(false) })
+			Required("type", "name", "version")
+		})
+		Result(DependencyGraph)
+		HTTP(func() {
+			GET("/resource/{type}/{name}/{version}/deps")
+			Param("transitive")
+			Response(StatusOK)
+		})
+	})
+})
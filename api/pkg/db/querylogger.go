@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type queryCountKey struct{}
+
+// QueryLogger wraps a *sqlx.DB so every statement run through its
+// GetContext or SelectContext is tallied against the counter (if any)
+// stashed in the request context by CountQueries. The other sqlx.DB
+// methods reach the embedded DB directly and are not counted. This exists so an N+1 regression shows up as "43 queries
+// for one request" in a log line instead of only as a slow endpoint.
+type QueryLogger struct {
+	*sqlx.DB
+}
+
+// NewQueryLogger wraps db so callers that keep using the familiar sqlx
+// GetContext and SelectContext get their query counted automatically.
+func NewQueryLogger(db *sqlx.DB) *QueryLogger {
+	return &QueryLogger{DB: db}
+}
+
+func (l *QueryLogger) count(ctx context.Context) {
+	if c, ok := ctx.Value(queryCountKey{}).(*int64); ok {
+		atomic.AddInt64(c, 1)
+	}
+}
+
+// GetContext behaves like sqlx.DB.GetContext but tallies the query against
+// the request's query counter.
+func (l *QueryLogger) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	l.count(ctx)
+	return l.DB.GetContext(ctx, dest, query, args...)
+}
+
+// SelectContext behaves like sqlx.DB.SelectContext but tallies the query
+// against the request's query counter.
+func (l *QueryLogger) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	l.count(ctx)
+	return l.DB.SelectContext(ctx, dest, query, args...)
+}
+
+// CountQueries returns a context carrying a fresh query counter, and a func
+// that reads the final tally. Install it once per incoming request (e.g.
+// from request-scoped middleware) and log the count when the request ends.
+func CountQueries(ctx context.Context) (context.Context, func() int64) {
+	var n int64
+	return context.WithValue(ctx, queryCountKey{}, &n), func() int64 {
+		return atomic.LoadInt64(&n)
+	}
+}
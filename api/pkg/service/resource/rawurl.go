@@ -0,0 +1,85 @@
+package resource
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RawURLResolver turns a catalog's web-facing URL (a GitHub/GitLab/Gitea/...
+// blob link) into the raw-content URL the hub can fetch directly. Different
+// git hosts spell this differently, so each provider gets its own
+// implementation instead of the single github.com-shaped string replacer
+// this used to be.
+type RawURLResolver interface {
+	Resolve(webURL string) (rawURL string, err error)
+}
+
+type githubResolver struct{}
+
+func (githubResolver) Resolve(webURL string) (string, error) {
+	r := strings.NewReplacer("github.com", "raw.githubusercontent.com", "/tree/", "/")
+	return r.Replace(webURL), nil
+}
+
+type gitlabResolver struct{}
+
+func (gitlabResolver) Resolve(webURL string) (string, error) {
+	return strings.Replace(webURL, "/-/blob/", "/-/raw/", 1), nil
+}
+
+type giteaResolver struct{}
+
+func (giteaResolver) Resolve(webURL string) (string, error) {
+	return strings.Replace(webURL, "/src/", "/raw/", 1), nil
+}
+
+type bitbucketResolver struct{}
+
+func (bitbucketResolver) Resolve(webURL string) (string, error) {
+	return strings.Replace(webURL, "/src/", "/raw/", 1), nil
+}
+
+// rawURLRule is one entry of the regex table backing regexResolver.
+type rawURLRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// regexResolver is the fallback resolver for providers the hub doesn't know
+// about by name. It lets operators teach it a new self-hosted git host
+// through config instead of a code change.
+type regexResolver struct {
+	rules []rawURLRule
+}
+
+func newRegexResolver(rules []rawURLRule) *regexResolver {
+	return &regexResolver{rules: rules}
+}
+
+func (r *regexResolver) Resolve(webURL string) (string, error) {
+	for _, rule := range r.rules {
+		if rule.Pattern.MatchString(webURL) {
+			return rule.Pattern.ReplaceAllString(webURL, rule.Replacement), nil
+		}
+	}
+	return "", fmt.Errorf("no raw URL resolver configured for %q", webURL)
+}
+
+// resolverFor returns the RawURLResolver to use for a catalog with the given
+// provider name, falling back to fallback when the provider isn't one of
+// the ones the hub knows natively.
+func resolverFor(provider string, fallback RawURLResolver) RawURLResolver {
+	switch strings.ToLower(provider) {
+	case "", "github":
+		return githubResolver{}
+	case "gitlab":
+		return gitlabResolver{}
+	case "gitea":
+		return giteaResolver{}
+	case "bitbucket":
+		return bitbucketResolver{}
+	default:
+		return fallback
+	}
+}
@@ -2,182 +2,736 @@ package resource
 
 import (
 	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/jinzhu/gorm"
+	sq "github.com/Masterminds/squirrel"
 	"go.uber.org/zap"
 
 	"github.com/tektoncd/hub/api/gen/resource"
 	"github.com/tektoncd/hub/api/pkg/app"
-	"github.com/tektoncd/hub/api/pkg/db/model"
+	"github.com/tektoncd/hub/api/pkg/db"
 )
 
+// psql builds queries using Postgres' $1, $2, ... placeholder style.
+var psql = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
 type service struct {
-	logger *zap.SugaredLogger
-	db     *gorm.DB
+	logger           *zap.SugaredLogger
+	db               *db.QueryLogger
+	fallbackResolver RawURLResolver
 }
 
-var replaceStrings = strings.NewReplacer("github.com", "raw.githubusercontent.com", "/tree/", "/")
-
 // Errors
 var (
-	fetchError    = resource.MakeInternalError(fmt.Errorf("Failed to fetch resources"))
-	notFoundError = resource.MakeNotFound(fmt.Errorf("Resource not found"))
+	fetchError         = resource.MakeInternalError(fmt.Errorf("Failed to fetch resources"))
+	notFoundError      = resource.MakeNotFound(fmt.Errorf("Resource not found"))
+	invalidCursorError = resource.MakeBadRequest(fmt.Errorf("Invalid cursor"))
 )
 
+// resourceCursor is the decoded form of the opaque, base64-encoded cursor
+// used to page through resource listings. It mirrors the ordering applied
+// by resourcesForQuery: rating DESC, name, id.
+type resourceCursor struct {
+	Rating int
+	Name   string
+	ID     uint
+}
+
+// versionCursor is the decoded form of the cursor used to page through a
+// resource's versions, ordered the same way as versionsSelect.
+type versionCursor struct {
+	Version string
+	ID      uint
+}
+
 // New returns the resource service implementation.
 func New(api app.Config) resource.Service {
-	return &service{api.Logger(), api.DB()}
+	rules := make([]rawURLRule, 0, len(api.RawURLRules()))
+	for _, rule := range api.RawURLRules() {
+		rules = append(rules, rawURLRule{Pattern: regexp.MustCompile(rule.Pattern), Replacement: rule.Replacement})
+	}
+
+	return &service{
+		logger:           api.Logger(),
+		db:               db.NewQueryLogger(api.SQLX()),
+		fallbackResolver: newRegexResolver(rules),
+	}
+}
+
+// countQueries installs a fresh query counter into ctx and returns a func
+// that logs the final tally against method. Nothing in this slice runs a
+// shared HTTP middleware chain in front of the service, so each exported
+// method installs its own counter at the point a request actually enters
+// this package; that's the only boundary this package owns.
+func (s *service) countQueries(ctx context.Context, method string) (context.Context, func()) {
+	ctx, tally := db.CountQueries(ctx)
+	return ctx, func() {
+		s.logger.Debugw("query count", "method", method, "count", tally())
+	}
+}
+
+// rawURLFor resolves the raw-content URL for a version hosted by the given
+// catalog, falling back to the web URL unchanged if no resolver can make
+// sense of it rather than failing the whole request over an optional field.
+func (s *service) rawURLFor(provider, webURL string) string {
+	raw, err := resolverFor(provider, s.fallbackResolver).Resolve(webURL)
+	if err != nil {
+		s.logger.Warnf("failed to resolve raw URL for %q: %v", webURL, err)
+		return webURL
+	}
+	return raw
+}
+
+// resourceRow is what a single row of resourceSelect (or one of the
+// by-version selects built on versionColumns) scans into:
+// a resource, its catalog and its latest version, with tags folded in as a
+// JSON array so the whole thing is one round trip instead of N+1 Preloads.
+type resourceRow struct {
+	ID     uint   `db:"id"`
+	Name   string `db:"name"`
+	Type   string `db:"type"`
+	Rating int    `db:"rating"`
+
+	CatalogID       uint   `db:"catalog_id"`
+	CatalogType     string `db:"catalog_type"`
+	CatalogProvider string `db:"catalog_provider"`
+
+	VersionID           uint      `db:"version_id"`
+	Version             string    `db:"version"`
+	Description         string    `db:"description"`
+	DisplayName         string    `db:"display_name"`
+	MinPipelinesVersion string    `db:"min_pipelines_version"`
+	URL                 string    `db:"url"`
+	UpdatedAt           time.Time `db:"updated_at"`
+	VCS                 string    `db:"vcs"`
+	VCSURL              string    `db:"vcs_url"`
+	VCSRef              string    `db:"vcs_ref"`
+	CommitSHA           string    `db:"commit_sha"`
+	VCSSubpath          string    `db:"vcs_subpath"`
+	FetchedAt           time.Time `db:"fetched_at"`
+
+	TagsJSON []byte `db:"tags_json"`
+}
+
+// versionRow is a single row of versionsSelect: one version plus just enough
+// of its catalog to resolve a raw URL.
+type versionRow struct {
+	ID          uint      `db:"id"`
+	Version     string    `db:"version"`
+	URL         string    `db:"url"`
+	VCS         string    `db:"vcs"`
+	VCSURL      string    `db:"vcs_url"`
+	VCSRef      string    `db:"vcs_ref"`
+	CommitSHA   string    `db:"commit_sha"`
+	VCSSubpath  string    `db:"vcs_subpath"`
+	FetchedAt   time.Time `db:"fetched_at"`
+	CatalogProv string    `db:"catalog_provider"`
+}
+
+type tagRow struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// tagsColumn is the LATERAL join shared by resourceSelect and
+// resourceByVersionSelect: it folds every tag of r into one json_agg so
+// fetching a page of resources costs one query, not one-plus-per-tag.
+const tagsColumn = `LEFT JOIN LATERAL (
+	SELECT json_agg(json_build_object('id', tg.id, 'name', tg.name) ORDER BY tg.name) AS tags
+	FROM resource_tags rt
+	JOIN tags tg ON tg.id = rt.tag_id
+	WHERE rt.resource_id = r.id
+) t ON true`
+
+var resourceColumns = []string{
+	"r.id", "r.name", "r.type", "r.rating",
+	"c.id AS catalog_id", "c.type AS catalog_type", "c.provider AS catalog_provider",
+	"lv.id AS version_id", "lv.version", "lv.description", "lv.display_name",
+	"lv.min_pipelines_version", "lv.url", "lv.updated_at",
+	"lv.vcs", "lv.vcs_url", "lv.vcs_ref", "lv.commit_sha", "lv.vcs_subpath", "lv.fetched_at",
+	"COALESCE(t.tags, '[]') AS tags_json",
+}
+
+// resourceSelect is the base query behind List/Query/ByTag: one row per
+// resource, its catalog and its highest-versioned release, tags folded in.
+func resourceSelect() sq.SelectBuilder {
+	return psql.Select(resourceColumns...).
+		From("resources r").
+		Join("catalogs c ON c.id = r.catalog_id").
+		JoinClause(`JOIN LATERAL (
+			SELECT * FROM resource_versions v
+			WHERE v.resource_id = r.id
+			ORDER BY string_to_array(v.version, '.')::int[] DESC
+			LIMIT 1
+		) lv ON true`).
+		JoinClause(tagsColumn)
+}
+
+// countSelect mirrors resourceSelect's FROM/JOIN/WHERE shape without the
+// LATERAL joins or LIMIT, so Total reflects the filters but not the page.
+func countSelect() sq.SelectBuilder {
+	return psql.Select("COUNT(*)").
+		From("resources r").
+		Join("catalogs c ON c.id = r.catalog_id")
+}
+
+// versionColumns is resourceColumns rewritten for queries that join a single
+// resource_versions row in as "v" instead of picking one via the "lv" LATERAL
+// join, so it stays in sync with resourceColumns automatically.
+func versionColumns() []string {
+	columns := make([]string, len(resourceColumns))
+	for i, c := range resourceColumns {
+		columns[i] = strings.ReplaceAll(c, "lv.", "v.")
+	}
+	return columns
+}
+
+// resourceByVersionSelect is ByTypeNameVersion's query: a resource joined to
+// one exact version instead of resourceSelect's "highest version" LATERAL.
+func resourceByVersionSelect(version string) sq.SelectBuilder {
+	return psql.Select(versionColumns()...).
+		From("resources r").
+		Join("catalogs c ON c.id = r.catalog_id").
+		Join("resource_versions v ON v.resource_id = r.id AND v.version = ?", version).
+		JoinClause(tagsColumn)
+}
+
+// versionsSelect returns every version of resourceID, newest first, along
+// with the catalog provider needed to resolve each one's raw URL.
+func versionsSelect(resourceID uint) sq.SelectBuilder {
+	return psql.Select(
+		"v.id", "v.version", "v.url",
+		"v.vcs", "v.vcs_url", "v.vcs_ref", "v.commit_sha", "v.vcs_subpath", "v.fetched_at",
+		"c.provider AS catalog_provider",
+	).
+		From("resource_versions v").
+		Join("resources r ON r.id = v.resource_id").
+		Join("catalogs c ON c.id = r.catalog_id").
+		Where(sq.Eq{"v.resource_id": resourceID}).
+		OrderBy("string_to_array(v.version, '.')::int[] DESC")
+}
+
+// filterByType restricts a resource query to a single, case-insensitive type.
+func filterByType(t string) sq.Sqlizer {
+	if t == "" {
+		return sq.Expr("TRUE")
+	}
+	return sq.Expr("LOWER(r.type) = ?", strings.ToLower(t))
+}
+
+// filterByName restricts a resource query to a single, case-insensitive name.
+func filterByName(name string) sq.Sqlizer {
+	if name == "" {
+		return sq.Expr("TRUE")
+	}
+	return sq.Expr("LOWER(r.name) = ?", strings.ToLower(name))
+}
+
+// matchesName restricts a resource query to names containing the given
+// substring, case-insensitively.
+func matchesName(name string) sq.Sqlizer {
+	if name == "" {
+		return sq.Expr("TRUE")
+	}
+	return sq.Expr("LOWER(r.name) LIKE ?", "%"+strings.ToLower(name)+"%")
 }
 
-// Find resources based on name, type or both
-func (s *service) Query(ctx context.Context, p *resource.QueryPayload) (res resource.ResourceCollection, err error) {
+// matchesTags restricts a resource query to resources carrying at least one
+// of the given tag names. When matchAll is true the resource must carry
+// every one of them instead.
+func matchesTags(tags []string, matchAll bool) sq.Sqlizer {
+	if len(tags) == 0 {
+		return sq.Expr("TRUE")
+	}
+
+	lower := make([]string, len(tags))
+	for i, t := range tags {
+		lower[i] = strings.ToLower(t)
+	}
+
+	// Built with the default "?" placeholder format, not psql's Dollar one:
+	// this fragment gets embedded as raw SQL into the outer query below, and
+	// it's the outer query's own ToSql() that renumbers every "?" it finds
+	// (here and in its own filters) into $1, $2, .... Pre-rendering this
+	// subquery to $-form would bake in placeholder numbers that collide with
+	// the outer query's once both are combined.
+	sub := sq.Select("1").
+		From("resource_tags rt").
+		Join("tags tg ON tg.id = rt.tag_id").
+		Where("rt.resource_id = r.id").
+		Where(sq.Eq{"LOWER(tg.name)": lower})
+
+	if matchAll {
+		sub = sub.GroupBy("rt.resource_id").Having("COUNT(DISTINCT LOWER(tg.name)) = ?", len(lower))
+	}
+
+	subSQL, args, err := sub.ToSql()
+	if err != nil {
+		return sq.Expr("TRUE")
+	}
+	return sq.Expr(fmt.Sprintf("EXISTS (%s)", subSQL), args...)
+}
 
-	q := s.db.Scopes(
-		withResourceDetails,
-		filterByType(p.Type),
-		matchesName(p.Name),
-	).Limit(p.Limit)
+// afterResource restricts a resource query to rows strictly after the given
+// cursor in (rating DESC, name, id) order. The rating term is negated so
+// the tuple comparison direction agrees with all three columns: Postgres
+// row comparison is lexicographic, so a plain "< (?, ?, ?)" would be correct
+// for rating but backwards for name/id, which sort ascending within a tied
+// rating bucket.
+func afterResource(c *resourceCursor) sq.Sqlizer {
+	if c == nil {
+		return sq.Expr("TRUE")
+	}
+	return sq.Expr("(-r.rating, r.name, r.id) > (?, ?, ?)", -c.Rating, c.Name, c.ID)
+}
 
-	return s.resourcesForQuery(q)
+// afterVersion restricts a versions query to rows strictly after the given
+// cursor, matching versionsSelect's ordering.
+func afterVersion(c *versionCursor) sq.Sqlizer {
+	if c == nil {
+		return sq.Expr("TRUE")
+	}
+	return sq.Expr(
+		"(string_to_array(v.version, '.')::int[], v.id) < (string_to_array(?, '.')::int[], ?)",
+		c.Version, c.ID,
+	)
+}
+
+// Find resources based on name, type, tags or a combination of these
+func (s *service) Query(ctx context.Context, p *resource.QueryPayload) (res *resource.ResourceList, err error) {
+	ctx, logQueryCount := s.countQueries(ctx, "Query")
+	defer logQueryCount()
+
+	after, err := decodeResourceCursor(p.After)
+	if err != nil {
+		return nil, invalidCursorError
+	}
+
+	where := sq.And{filterByType(p.Type), matchesName(p.Name), matchesTags(p.Tags, p.MatchAll)}
+
+	return s.resourcesForQuery(ctx, where, after, p.Limit)
+}
+
+// ByTag finds resources carrying the given tag, sorted by rating and name.
+// It lets callers browse a catalog by tag (e.g. "all tasks tagged kaniko")
+// without first knowing a resource name.
+func (s *service) ByTag(ctx context.Context, p *resource.ByTagPayload) (res *resource.ResourceList, err error) {
+	ctx, logQueryCount := s.countQueries(ctx, "ByTag")
+	defer logQueryCount()
+
+	after, err := decodeResourceCursor(p.After)
+	if err != nil {
+		return nil, invalidCursorError
+	}
+
+	where := sq.And{matchesTags([]string{p.Tag}, false)}
+
+	return s.resourcesForQuery(ctx, where, after, p.Limit)
 }
 
 // List all resources sorted by rating and name
-func (s *service) List(ctx context.Context, p *resource.ListPayload) (res resource.ResourceCollection, err error) {
-	q := s.db.Scopes(withResourceDetails).Limit(p.Limit)
-	return s.resourcesForQuery(q)
+func (s *service) List(ctx context.Context, p *resource.ListPayload) (res *resource.ResourceList, err error) {
+	ctx, logQueryCount := s.countQueries(ctx, "List")
+	defer logQueryCount()
+
+	after, err := decodeResourceCursor(p.After)
+	if err != nil {
+		return nil, invalidCursorError
+	}
+
+	return s.resourcesForQuery(ctx, sq.And{}, after, p.Limit)
 }
 
 // VersionsByID returns all versions of a resource given its resource id
 func (s *service) VersionsByID(ctx context.Context, p *resource.VersionsByIDPayload) (res *resource.Versions, err error) {
+	ctx, logQueryCount := s.countQueries(ctx, "VersionsByID")
+	defer logQueryCount()
+
+	after, err := decodeVersionCursor(p.After)
+	if err != nil {
+		return nil, invalidCursorError
+	}
+
+	var total int
+	countSQL, countArgs, err := psql.Select("COUNT(*)").From("resource_versions v").
+		Where(sq.Eq{"v.resource_id": p.ID}).ToSql()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, fetchError
+	}
+	if err := s.db.GetContext(ctx, &total, countSQL, countArgs...); err != nil {
+		s.logger.Error(err)
+		return nil, fetchError
+	}
 
-	q := s.db.Scopes(orderByVersion, filterByResourceID(p.ID))
+	querySQL, args, err := versionsSelect(p.ID).
+		Where(afterVersion(after)).
+		Limit(uint64(p.Limit) + 1).
+		ToSql()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, fetchError
+	}
 
-	var all []model.ResourceVersion
-	if err := q.Find(&all).Error; err != nil {
+	var rows []versionRow
+	if err := s.db.SelectContext(ctx, &rows, querySQL, args...); err != nil {
 		s.logger.Error(err)
 		return nil, fetchError
 	}
 
-	if len(all) == 0 {
+	// One row past the limit is fetched only to tell whether another page follows.
+	hasMore := p.Limit >= 0 && len(rows) > p.Limit
+	if hasMore {
+		rows = rows[:p.Limit]
+	}
+
+	if len(rows) == 0 {
 		return nil, notFoundError
 	}
 
 	var allVersions []*resource.Version
-	for _, r := range all {
-		allVersions = append(allVersions, minVersionInfo(r))
+	for _, r := range rows {
+		allVersions = append(allVersions, s.minVersionInfo(r))
+	}
+
+	// The true latest version, independent of which page we're on: rows[0]
+	// is only the highest version on page 1 (After == ""); on later pages
+	// it's just the first version after the cursor.
+	latestSQL, latestArgs, err := versionsSelect(p.ID).Limit(1).ToSql()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, fetchError
+	}
+	var latest versionRow
+	if err := s.db.GetContext(ctx, &latest, latestSQL, latestArgs...); err != nil {
+		s.logger.Error(err)
+		return nil, fetchError
+	}
+	latestVersion := s.minVersionInfo(latest)
+
+	nextCursor := ""
+	if hasMore {
+		last := rows[len(rows)-1]
+		nextCursor = encodeVersionCursor(last)
 	}
-	latestVersion := minVersionInfo(all[len(all)-1])
 
 	res = &resource.Versions{
-		Latest:   latestVersion,
-		Versions: allVersions,
+		Latest:     latestVersion,
+		Versions:   allVersions,
+		NextCursor: nextCursor,
+		Total:      total,
 	}
 
 	return res, nil
 }
 
 func (s *service) ByTypeNameVersion(ctx context.Context, p *resource.ByTypeNameVersionPayload) (res *resource.Version, err error) {
+	ctx, logQueryCount := s.countQueries(ctx, "ByTypeNameVersion")
+	defer logQueryCount()
+
+	querySQL, args, err := resourceByVersionSelect(p.Version).
+		Where(filterByType(p.Type)).
+		Where(filterByName(p.Name)).
+		ToSql()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, fetchError
+	}
 
-	q := s.db.Scopes(
-		withVersionInfo(p.Version),
-		filterByType(p.Type),
-		filterByName(p.Name))
-
-	var r model.Resource
-	if err := q.Find(&r).Error; err != nil {
-		if gorm.IsRecordNotFoundError(err) {
+	var r resourceRow
+	if err := s.db.GetContext(ctx, &r, querySQL, args...); err != nil {
+		if err == sql.ErrNoRows {
 			return nil, notFoundError
 		}
 		s.logger.Error(err)
 		return nil, fetchError
 	}
 
-	switch count := len(r.Versions); {
-	case count == 1:
-		return completeVersionInfo(r), nil
-	case count == 0:
-		return nil, notFoundError
-	default:
-		s.logger.Warnf("expected to find one version but found %d", count)
-		r.Versions = []model.ResourceVersion{r.Versions[0]}
-		return completeVersionInfo(r), nil
+	return s.completeVersionInfo(r)
+}
+
+// Dependencies resolves the taskRef/stepAction references a pipeline or
+// task version carries into the hub's own catalog, so an installer can
+// pull the whole closure in one shot instead of discovering each task by
+// hand. With transitive set, it walks dependencies-of-dependencies too.
+func (s *service) Dependencies(ctx context.Context, p *resource.DependenciesPayload) (res *resource.DependencyGraph, err error) {
+	ctx, logQueryCount := s.countQueries(ctx, "Dependencies")
+	defer logQueryCount()
+
+	root, err := s.ByTypeNameVersion(ctx, &resource.ByTypeNameVersionPayload{
+		Type:    p.Type,
+		Name:    p.Name,
+		Version: p.Version,
+	})
+	if err != nil {
+		return nil, err
 	}
+
+	nodes := map[uint]*resource.Version{root.ID: root}
+	seen := map[uint]bool{root.ID: true}
+	var edges []*resource.DependencyEdge
+
+	queue := []*resource.Version{root}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		deps, err := s.directDependencies(ctx, cur.ID)
+		if err != nil {
+			s.logger.Error(err)
+			return nil, fetchError
+		}
+
+		for _, d := range deps {
+			resolved, err := s.resolveDependency(ctx, d)
+			if err != nil {
+				s.logger.Warnf("could not resolve dependency %s/%s >= %s: %v", d.ToType, d.ToName, d.ToMinVersion, err)
+				continue
+			}
+
+			edges = append(edges, &resource.DependencyEdge{From: cur.ID, To: resolved.ID})
+
+			if seen[resolved.ID] {
+				continue
+			}
+			seen[resolved.ID] = true
+			nodes[resolved.ID] = resolved
+			if p.Transitive {
+				queue = append(queue, resolved)
+			}
+		}
+	}
+
+	graph := &resource.DependencyGraph{}
+	for _, n := range nodes {
+		graph.Nodes = append(graph.Nodes, n)
+	}
+	graph.Edges = edges
+
+	return graph, nil
 }
 
-func (s *service) resourcesForQuery(q *gorm.DB) (resource.ResourceCollection, error) {
+// dependencyRow is one row of resource_dependency: a taskRef/stepAction
+// reference extracted from a version's YAML, pointing at the lowest
+// acceptable version of some other resource, pre-resolved when ingestion
+// already knew which version that was.
+type dependencyRow struct {
+	FromVersionID       uint    `db:"from_version_id"`
+	ToType              string  `db:"to_type"`
+	ToName              string  `db:"to_name"`
+	ToMinVersion        string  `db:"to_min_version"`
+	ResolvedToVersionID *uint64 `db:"resolved_to_version_id"`
+}
+
+func (s *service) directDependencies(ctx context.Context, versionID uint) ([]dependencyRow, error) {
+	querySQL, args, err := psql.Select(
+		"from_version_id", "to_type", "to_name", "to_min_version", "resolved_to_version_id",
+	).
+		From("resource_dependency").
+		Where(sq.Eq{"from_version_id": versionID}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []dependencyRow
+	if err := s.db.SelectContext(ctx, &rows, querySQL, args...); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// resolveDependency turns a dependencyRow into the concrete version it
+// points at: the pre-resolved version if ingestion already recorded one,
+// otherwise the highest version of (to_type, to_name) satisfying to_min_version.
+func (s *service) resolveDependency(ctx context.Context, d dependencyRow) (*resource.Version, error) {
+	var (
+		querySQL string
+		args     []interface{}
+		err      error
+	)
+
+	if d.ResolvedToVersionID != nil {
+		querySQL, args, err = resourceByVersionIDSelect(uint(*d.ResolvedToVersionID)).ToSql()
+	} else {
+		querySQL, args, err = dependencyTargetSelect(d.ToType, d.ToName, d.ToMinVersion).ToSql()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var r resourceRow
+	if err := s.db.GetContext(ctx, &r, querySQL, args...); err != nil {
+		return nil, err
+	}
+
+	return s.completeVersionInfo(r)
+}
+
+// resourceByVersionIDSelect is resourceByVersionSelect's counterpart keyed
+// by resource_versions.id instead of a version string, used to fetch a
+// dependency's already-resolved target version directly.
+func resourceByVersionIDSelect(versionID uint) sq.SelectBuilder {
+	return psql.Select(versionColumns()...).
+		From("resources r").
+		Join("catalogs c ON c.id = r.catalog_id").
+		Join("resource_versions v ON v.resource_id = r.id AND v.id = ?", versionID).
+		JoinClause(tagsColumn)
+}
+
+// dependencyTargetSelect finds the highest version of (toType, toName) that
+// satisfies toMinVersion, for resolving a dependency the ingestion job
+// wasn't able to pin to a specific version up front.
+func dependencyTargetSelect(toType, toName, toMinVersion string) sq.SelectBuilder {
+	return psql.Select(versionColumns()...).
+		From("resources r").
+		Join("catalogs c ON c.id = r.catalog_id").
+		JoinClause(`JOIN LATERAL (
+			SELECT * FROM resource_versions v
+			WHERE v.resource_id = r.id
+			  AND string_to_array(v.version, '.')::int[] >= string_to_array(?, '.')::int[]
+			ORDER BY string_to_array(v.version, '.')::int[] DESC
+			LIMIT 1
+		) v ON true`, toMinVersion).
+		JoinClause(tagsColumn).
+		Where(filterByType(toType)).
+		Where(filterByName(toName))
+}
+
+// resourcesForQuery runs the shared resource listing query under the given
+// filters, positioned after the cursor (if any) and bounded to limit rows,
+// plus a second, unordered/unlimited query to compute Total.
+func (s *service) resourcesForQuery(ctx context.Context, where sq.Sqlizer, after *resourceCursor, limit int) (*resource.ResourceList, error) {
+
+	countSQL, countArgs, err := countSelect().Where(where).ToSql()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, fetchError
+	}
+
+	var total int
+	if err := s.db.GetContext(ctx, &total, countSQL, countArgs...); err != nil {
+		s.logger.Error(err)
+		return nil, fetchError
+	}
+
+	querySQL, args, err := resourceSelect().
+		Where(where).
+		Where(afterResource(after)).
+		OrderBy("r.rating DESC, r.name, r.id").
+		Limit(uint64(limit) + 1).
+		ToSql()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, fetchError
+	}
 
-	var rs []model.Resource
-	if err := q.Find(&rs).Error; err != nil {
+	var rows []resourceRow
+	if err := s.db.SelectContext(ctx, &rows, querySQL, args...); err != nil {
 		s.logger.Error(err)
 		return nil, fetchError
 	}
 
-	if len(rs) == 0 {
+	// One row past limit is fetched only to tell whether another page follows.
+	hasMore := limit >= 0 && len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	if len(rows) == 0 {
 		return nil, notFoundError
 	}
 
 	res := resource.ResourceCollection{}
-	for _, r := range rs {
-		res = append(res, initResource(r))
+	for _, r := range rows {
+		ir, err := s.initResource(r)
+		if err != nil {
+			s.logger.Error(err)
+			return nil, fetchError
+		}
+		res = append(res, ir)
 	}
 
-	return res, nil
+	nextCursor := ""
+	if hasMore {
+		nextCursor = encodeResourceCursor(rows[len(rows)-1])
+	}
+
+	return &resource.ResourceList{
+		Resources:  res,
+		NextCursor: nextCursor,
+		Total:      total,
+	}, nil
 }
 
-func initResource(r model.Resource) *resource.Resource {
-	res := &resource.Resource{}
-	res.ID = r.ID
-	res.Name = r.Name
-	res.Catalog = &resource.Catalog{
-		ID:   r.Catalog.ID,
-		Type: r.Catalog.Type,
+func (s *service) tagsFromRow(raw []byte) ([]*resource.Tag, error) {
+	var parsed []tagRow
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, err
 	}
-	res.Type = r.Type
-	res.Rating = r.Rating
 
-	lv := (r.Versions)[len(r.Versions)-1]
-	res.LatestVersion = &resource.LatestVersion{
-		ID:                  lv.ID,
-		Version:             lv.Version,
-		Description:         lv.Description,
-		DisplayName:         lv.DisplayName,
-		MinPipelinesVersion: lv.MinPipelinesVersion,
-		WebURL:              lv.URL,
-		RawURL:              replaceStrings.Replace(lv.URL),
-		UpdatedAt:           lv.UpdatedAt.UTC().String(),
+	tags := make([]*resource.Tag, 0, len(parsed))
+	for _, t := range parsed {
+		tags = append(tags, &resource.Tag{ID: t.ID, Name: t.Name})
 	}
-	for _, tag := range r.Tags {
-		res.Tags = append(res.Tags, &resource.Tag{
-			ID:   tag.ID,
-			Name: tag.Name,
-		})
+	return tags, nil
+}
+
+func (s *service) initResource(r resourceRow) (*resource.Resource, error) {
+	tags, err := s.tagsFromRow(r.TagsJSON)
+	if err != nil {
+		return nil, err
 	}
 
-	return res
+	res := &resource.Resource{
+		ID:     r.ID,
+		Name:   r.Name,
+		Type:   r.Type,
+		Rating: r.Rating,
+		Tags:   tags,
+		Catalog: &resource.Catalog{
+			ID:   r.CatalogID,
+			Type: r.CatalogType,
+		},
+		LatestVersion: &resource.LatestVersion{
+			ID:                  r.VersionID,
+			Version:             r.Version,
+			Description:         r.Description,
+			DisplayName:         r.DisplayName,
+			MinPipelinesVersion: r.MinPipelinesVersion,
+			WebURL:              r.URL,
+			RawURL:              s.rawURLFor(r.CatalogProvider, r.URL),
+			UpdatedAt:           r.UpdatedAt.UTC().String(),
+			Origin:              originInfoFromResourceRow(r),
+		},
+	}
+
+	return res, nil
 }
 
-func minVersionInfo(r model.ResourceVersion) *resource.Version {
-	res := &resource.Version{
+func (s *service) minVersionInfo(r versionRow) *resource.Version {
+	return &resource.Version{
 		ID:      r.ID,
 		Version: r.Version,
 		WebURL:  r.URL,
-		RawURL:  replaceStrings.Replace(r.URL),
+		RawURL:  s.rawURLFor(r.CatalogProv, r.URL),
+		Origin:  originInfoFromVersionRow(r),
 	}
-
-	return res
 }
 
-func completeVersionInfo(r model.Resource) *resource.Version {
-
-	tags := []*resource.Tag{}
-	for _, tag := range r.Tags {
-		tags = append(tags, &resource.Tag{
-			ID:   tag.ID,
-			Name: tag.Name,
-		})
+func (s *service) completeVersionInfo(r resourceRow) (*resource.Version, error) {
+	tags, err := s.tagsFromRow(r.TagsJSON)
+	if err != nil {
+		return nil, err
 	}
+
 	res := &resource.Resource{
 		ID:     r.ID,
 		Name:   r.Name,
@@ -185,92 +739,115 @@ func completeVersionInfo(r model.Resource) *resource.Version {
 		Rating: r.Rating,
 		Tags:   tags,
 		Catalog: &resource.Catalog{
-			ID:   r.Catalog.ID,
-			Type: r.Type,
+			ID:   r.CatalogID,
+			Type: r.CatalogType,
 		},
 	}
 
-	v := r.Versions[0]
-	ver := &resource.Version{
-		ID:                  v.ID,
-		Version:             v.Version,
-		Description:         v.Description,
-		DisplayName:         v.DisplayName,
-		MinPipelinesVersion: v.MinPipelinesVersion,
-		WebURL:              v.URL,
-		RawURL:              replaceStrings.Replace(v.URL),
-		UpdatedAt:           v.UpdatedAt.UTC().String(),
+	return &resource.Version{
+		ID:                  r.VersionID,
+		Version:             r.Version,
+		Description:         r.Description,
+		DisplayName:         r.DisplayName,
+		MinPipelinesVersion: r.MinPipelinesVersion,
+		WebURL:              r.URL,
+		RawURL:              s.rawURLFor(r.CatalogProvider, r.URL),
+		UpdatedAt:           r.UpdatedAt.UTC().String(),
+		Origin:              originInfoFromResourceRow(r),
 		Resource:            res,
-	}
+	}, nil
+}
 
-	return ver
+// originInfoFromResourceRow builds the catalog origin metadata for a
+// version fetched as part of a resourceRow: the VCS ref it was pulled from,
+// the commit it resolved to, and when that fetch happened. It mirrors the
+// way `go mod download` records an Origin alongside a module version so
+// clients can cheaply revalidate without re-fetching or re-parsing.
+//
+// These fields are only as good as what the catalog refresh job wrote at
+// ingest time; this package just reads columns, it doesn't populate them.
+func originInfoFromResourceRow(r resourceRow) *resource.Origin {
+	return &resource.Origin{
+		VCS:       r.VCS,
+		URL:       r.VCSURL,
+		Ref:       r.VCSRef,
+		CommitSHA: r.CommitSHA,
+		Subpath:   r.VCSSubpath,
+		FetchedAt: r.FetchedAt.UTC().String(),
+	}
 }
 
-func withCatalogAndTags(db *gorm.DB) *gorm.DB {
-	return db.
-		Preload("Catalog").
-		Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("tags.name ASC") })
+func originInfoFromVersionRow(r versionRow) *resource.Origin {
+	return &resource.Origin{
+		VCS:       r.VCS,
+		URL:       r.VCSURL,
+		Ref:       r.VCSRef,
+		CommitSHA: r.CommitSHA,
+		Subpath:   r.VCSSubpath,
+		FetchedAt: r.FetchedAt.UTC().String(),
+	}
 }
 
-// withResourceDetails defines a gorm scope to include all details of resource.
-func withResourceDetails(db *gorm.DB) *gorm.DB {
-	return db.
-		Order("rating DESC, name").
-		Scopes(withCatalogAndTags).
-		Preload("Versions", orderByVersion)
+func encodeResourceCursor(r resourceRow) string {
+	raw := fmt.Sprintf("%d\x1f%s\x1f%d", r.Rating, r.Name, r.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
 }
 
-func withVersionInfo(version string) func(db *gorm.DB) *gorm.DB {
-	return func(db *gorm.DB) *gorm.DB {
-		return db.
-			Scopes(withResourceDetails).
-			Preload("Versions", "version = ?", version)
+func decodeResourceCursor(s string) (*resourceCursor, error) {
+	if s == "" {
+		return nil, nil
 	}
-}
 
-func orderByVersion(db *gorm.DB) *gorm.DB {
-	return db.Order("string_to_array(version, '.')::int[];")
-}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
 
-func filterByType(t string) func(db *gorm.DB) *gorm.DB {
-	if t == "" {
-		return noop
+	// Rating and ID are plain integers, so the name is everything between the
+	// first and the last separator, even if the name itself contains one.
+	text := string(raw)
+	first := strings.Index(text, "\x1f")
+	last := strings.LastIndex(text, "\x1f")
+	if first < 0 || first == last {
+		return nil, fmt.Errorf("malformed cursor")
 	}
 
-	t = strings.ToLower(t)
-	return func(db *gorm.DB) *gorm.DB {
-		return db.Where("LOWER(type) = ?", t)
+	rating, err := strconv.Atoi(text[:first])
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseUint(text[last+1:], 10, 64)
+	if err != nil {
+		return nil, err
 	}
+
+	return &resourceCursor{Rating: rating, Name: text[first+1 : last], ID: uint(id)}, nil
 }
 
-func filterByResourceID(id uint) func(db *gorm.DB) *gorm.DB {
-	return func(db *gorm.DB) *gorm.DB {
-		return db.Where("resource_id = ?", id)
-	}
+func encodeVersionCursor(v versionRow) string {
+	raw := fmt.Sprintf("%s\x1f%d", v.Version, v.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
 }
 
-func filterByName(name string) func(db *gorm.DB) *gorm.DB {
-	if name == "" {
-		return noop
+func decodeVersionCursor(s string) (*versionCursor, error) {
+	if s == "" {
+		return nil, nil
 	}
 
-	name = strings.ToLower(name)
-	return func(db *gorm.DB) *gorm.DB {
-		return db.Where("LOWER(name) = ?", name)
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func matchesName(name string) func(db *gorm.DB) *gorm.DB {
-	if name == "" {
-		return noop
+	parts := strings.Split(string(raw), "\x1f")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed cursor")
 	}
 
-	return func(db *gorm.DB) *gorm.DB {
-		str := "%" + strings.ToLower(name) + "%"
-		return db.Where("LOWER(name) LIKE ?", str)
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func noop(db *gorm.DB) *gorm.DB {
-	return db
+	return &versionCursor{Version: parts[0], ID: uint(id)}, nil
 }
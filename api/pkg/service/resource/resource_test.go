@@ -0,0 +1,232 @@
+package resource
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// TestMatchesTagsPlaceholderNumbering guards against the tag-filter subquery
+// being pre-rendered with its own $1, $2, ... placeholders before being
+// embedded in the outer query: once combined with other filters or a
+// pagination cursor, that used to leave the outer ToSql() renumbering pass
+// colliding two unrelated values onto the same $N and the arg count out of
+// sync with the placeholder count.
+func TestMatchesTagsPlaceholderNumbering(t *testing.T) {
+	cases := []struct {
+		name  string
+		where sq.Sqlizer
+	}{
+		{
+			name:  "tag filter alone",
+			where: sq.And{matchesTags([]string{"kaniko"}, false)},
+		},
+		{
+			name: "tag filter combined with type/name filters and a cursor",
+			where: sq.And{
+				filterByType("task"),
+				matchesName("kaniko"),
+				matchesTags([]string{"build", "ci"}, false),
+				afterResource(&resourceCursor{Rating: 5, Name: "foo", ID: 3}),
+			},
+		},
+		{
+			name: "match-all tags combined with other filters",
+			where: sq.And{
+				filterByType("task"),
+				matchesTags([]string{"build", "ci"}, true),
+			},
+		},
+	}
+
+	placeholder := regexp.MustCompile(`\$(\d+)`)
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			query, args, err := resourceSelect().Where(c.where).ToSql()
+			if err != nil {
+				t.Fatalf("ToSql: %v", err)
+			}
+
+			matches := placeholder.FindAllStringSubmatch(query, -1)
+			seen := make(map[int]int)
+			max := 0
+			for _, m := range matches {
+				n, err := strconv.Atoi(m[1])
+				if err != nil {
+					t.Fatalf("unexpected placeholder %q", m[0])
+				}
+				seen[n]++
+				if n > max {
+					max = n
+				}
+			}
+
+			if max != len(args) {
+				t.Fatalf("query references up to $%d but got %d args: %s", max, len(args), query)
+			}
+			for n := 1; n <= max; n++ {
+				if seen[n] != 1 {
+					t.Fatalf("placeholder $%d appears %d times, want exactly once (reused across unrelated values): %s", n, seen[n], query)
+				}
+			}
+		})
+	}
+}
+
+// TestByTagMatchesTagsQueryable exercises the query ByTag actually builds
+// (matchesTags alone, no other filters) end to end through resourceSelect.
+func TestByTagMatchesTagsQueryable(t *testing.T) {
+	where := sq.And{matchesTags([]string{"kaniko"}, false)}
+
+	query, args, err := resourceSelect().Where(where).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql: %v", err)
+	}
+	if len(args) != 1 {
+		t.Fatalf("expected exactly 1 arg for a single tag filter, got %d: %v", len(args), args)
+	}
+	if args[0] != "kaniko" {
+		t.Fatalf("expected arg %q, got %q", "kaniko", args[0])
+	}
+	if !regexp.MustCompile(`EXISTS \(SELECT 1`).MatchString(query) {
+		t.Fatalf("expected an EXISTS subquery in generated SQL, got: %s", query)
+	}
+}
+
+func TestResourceCursorRoundTrip(t *testing.T) {
+	cases := []resourceCursor{
+		{Rating: 5, Name: "kaniko", ID: 42},
+		{Rating: 0, Name: "", ID: 1},
+		{Rating: -1, Name: "has\x1fno-delimiter-collision", ID: 7},
+	}
+
+	for _, c := range cases {
+		encoded := encodeResourceCursor(resourceRow{Rating: c.Rating, Name: c.Name, ID: c.ID})
+
+		decoded, err := decodeResourceCursor(encoded)
+		if err != nil {
+			t.Fatalf("decodeResourceCursor(%q): %v", encoded, err)
+		}
+		if *decoded != c {
+			t.Fatalf("round-trip mismatch: got %+v, want %+v", *decoded, c)
+		}
+	}
+}
+
+func TestVersionCursorRoundTrip(t *testing.T) {
+	cases := []versionCursor{
+		{Version: "1.2.3", ID: 42},
+		{Version: "0.0.1", ID: 1},
+	}
+
+	for _, c := range cases {
+		encoded := encodeVersionCursor(versionRow{Version: c.Version, ID: c.ID})
+
+		decoded, err := decodeVersionCursor(encoded)
+		if err != nil {
+			t.Fatalf("decodeVersionCursor(%q): %v", encoded, err)
+		}
+		if *decoded != c {
+			t.Fatalf("round-trip mismatch: got %+v, want %+v", *decoded, c)
+		}
+	}
+}
+
+func TestDecodeResourceCursorEmpty(t *testing.T) {
+	decoded, err := decodeResourceCursor("")
+	if err != nil {
+		t.Fatalf("decodeResourceCursor(\"\"): %v", err)
+	}
+	if decoded != nil {
+		t.Fatalf("expected nil cursor for empty input, got %+v", decoded)
+	}
+}
+
+func TestDecodeResourceCursorMalformed(t *testing.T) {
+	if _, err := decodeResourceCursor("not-valid-base64!!"); err == nil {
+		t.Fatal("expected an error decoding malformed cursor, got nil")
+	}
+}
+
+// TestAfterResourceNegatesRating guards against (r.rating, r.name, r.id) <
+// (?, ?, ?) being used directly: that direction is only correct for rating
+// (DESC); name/id sort ASC within a tied rating bucket, so the SQL must
+// negate rating to make the comparison agree across all three columns.
+func TestAfterResourceNegatesRating(t *testing.T) {
+	query, args, err := sq.Select("1").Where(afterResource(&resourceCursor{Rating: 10, Name: "b", ID: 2})).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql: %v", err)
+	}
+	if !regexp.MustCompile(`\(-r\.rating, r\.name, r\.id\) > `).MatchString(query) {
+		t.Fatalf("expected a negated-rating, strictly-greater-than keyset predicate, got: %s", query)
+	}
+	if len(args) != 3 || args[0] != -10 {
+		t.Fatalf("expected first arg to be the negated cursor rating (-10), got %v", args)
+	}
+}
+
+// TestResourceKeysetPaginationDoesNotDropTiedRatings is the regression case
+// from the review: with several names tied on the same rating, a page
+// boundary landing mid-bucket must not silently skip the remaining names in
+// that bucket in favor of jumping straight to a lower rating.
+func TestResourceKeysetPaginationDoesNotDropTiedRatings(t *testing.T) {
+	// Already in (rating DESC, name ASC, id ASC) order, matching the
+	// production ORDER BY.
+	rows := []resourceCursor{
+		{Rating: 10, Name: "a", ID: 1},
+		{Rating: 10, Name: "b", ID: 2},
+		{Rating: 10, Name: "c", ID: 3},
+		{Rating: 5, Name: "a", ID: 4},
+	}
+
+	const pageSize = 2
+	var after *resourceCursor
+	var seen []resourceCursor
+
+	for {
+		var page []resourceCursor
+		for _, r := range rows {
+			if after != nil && !afterResourceCursor(r, after) {
+				continue
+			}
+			page = append(page, r)
+			if len(page) == pageSize {
+				break
+			}
+		}
+		if len(page) == 0 {
+			break
+		}
+		seen = append(seen, page...)
+		last := page[len(page)-1]
+		after = &last
+		if len(page) < pageSize {
+			break
+		}
+	}
+
+	if len(seen) != len(rows) {
+		t.Fatalf("expected all %d rows across pages, got %d: %+v", len(rows), len(seen), seen)
+	}
+	for i, r := range rows {
+		if seen[i] != r {
+			t.Fatalf("row %d: got %+v, want %+v (full result: %+v)", i, seen[i], r, seen)
+		}
+	}
+}
+
+// afterResourceCursor is a pure-Go mirror of afterResource's SQL predicate,
+// used to drive TestResourceKeysetPaginationDoesNotDropTiedRatings without a
+// database.
+func afterResourceCursor(r resourceCursor, c *resourceCursor) bool {
+	if r.Rating != c.Rating {
+		return -r.Rating > -c.Rating
+	}
+	if r.Name != c.Name {
+		return r.Name > c.Name
+	}
+	return r.ID > c.ID
+}